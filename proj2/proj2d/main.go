@@ -2,25 +2,38 @@ package main
 
 import (
 	"context"
+	"errors"
+	"github.com/nizsheanez/monorepo/todo/pkg/grpcerrors"
 	"github.com/nizsheanez/monorepo/todo/projects"
+	"github.com/nizsheanez/monorepo/todo/proxy"
 	"github.com/nizsheanez/monorepo/todo/todo"
 	"google.golang.org/grpc"
 	"log"
+	"strings"
 )
 
-var serverAddr = "127.0.0.1"
+// serverAddrs lists the todo gRPC backends this client fails over between,
+// comma-separated. It is a fixed value: no flag or environment variable
+// overrides it.
+var serverAddrs = "127.0.0.1"
 
 func main() {
 	client := proto.NewGreeterService("greeter", service.Client())
 
-	conn, err := grpc.Dial(serverAddr)
+	pool, err := proxy.NewFailoverConnPool(strings.Split(serverAddrs, ","), grpc.WithUnaryInterceptor(grpcerrors.UnaryClientInterceptor()))
 	if err != nil {
 		log.Fatalf("can't connect todo: %s", err)
 	}
 
-	todoApi := todo.NewApiClient(conn)
-	projectsApi := projects.NewApiClient(conn)
+	todoApi := todo.NewApiClient(pool)
+	projectsApi := projects.NewApiClient(pool)
 
-	todoApi.List(context.Background(), &todo.ListRequest{})
+	if _, err := todoApi.List(context.Background(), &todo.ListRequest{}); err != nil {
+		if errors.Is(err, grpcerrors.ErrNotFound) {
+			log.Printf("todo list: nothing found: %s", err)
+		} else {
+			log.Printf("todo list: %s", err)
+		}
+	}
 	projectsApi.List(context.Background(), &projects.ListRequest{})
 }
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"github.com/urfave/cli"
+
+	appsrv "github.com/nizsheanez/monorepo/todo/app"
+)
+
+// commonFlags is app.Flags for this server. It was missing from this
+// snapshot; add new flags here rather than reading an unregistered
+// c.String/c.Duration, which urfave/cli silently returns as the zero value.
+var commonFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "env",
+		Value: "local",
+		Usage: "deployment environment (local, gcp, aws)",
+	},
+	cli.StringFlag{
+		Name:  "bind-grpc",
+		Value: "8081",
+		Usage: "port the gRPC server listens on",
+	},
+	cli.StringFlag{
+		Name:  "bind-http",
+		Value: "8080",
+		Usage: "port the grpc-gateway HTTP server listens on",
+	},
+	cli.StringFlag{
+		Name:  "bind-prometheus-http",
+		Value: "127.0.0.1:9090",
+		Usage: "address the Prometheus metrics/health HTTP server listens on",
+	},
+	cli.StringFlag{
+		Name:  "grpc-backends",
+		Usage: "comma-separated backend addresses the HTTP gateway's FailoverConnPool dials, defaults to bind-grpc",
+	},
+	cli.DurationFlag{
+		Name:  appsrv.ShutdownTimeoutFlagName,
+		Value: appsrv.DefaultShutdownTimeout,
+		Usage: "how long to wait for in-flight work to drain on shutdown",
+	},
+	cli.StringFlag{
+		Name:  appsrv.GRPCLatencyBucketsFlagName,
+		Usage: "comma-separated gRPC handling-time histogram buckets in seconds, defaults to 0.001,0.005,0.01,0.025,0.05,0.1,0.25,0.5,1,2.5,5",
+	},
+}
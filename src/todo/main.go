@@ -2,16 +2,19 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"os"
 	"path"
 	"runtime"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/globalsign/mgo"
-	"github.com/google/go-cloud/health"
+	gohealth "github.com/google/go-cloud/health"
 	"github.com/google/go-cloud/runtimevar"
 	"github.com/google/go-cloud/server"
 	"github.com/google/go-cloud/wire"
@@ -22,6 +25,11 @@ import (
 	"github.com/nizsheanez/monorepo/src/todo/api/todo/v2"
 	"github.com/nizsheanez/monorepo/src/todo/model"
 	"github.com/nizsheanez/monorepo/src/todo/service"
+	appsrv "github.com/nizsheanez/monorepo/todo/app"
+	todohealth "github.com/nizsheanez/monorepo/todo/health"
+	"github.com/nizsheanez/monorepo/todo/proxy"
+	"github.com/nizsheanez/monorepo/todo/service/registry"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/urfave/cli"
 	"go.opencensus.io/trace"
@@ -65,22 +73,13 @@ var applicationSet = wire.NewSet(
 	trace.AlwaysSample,
 )
 
-type fakeHealthChecker struct{}
-
-func (*fakeHealthChecker) CheckHealth() error {
-	return nil
-}
-
-// appHealthChecks returns a health check for the database. This will signal
-// to Kubernetes or other orchestrators that the server should not receive
-// traffic until the server is able to connect to its database.
-func appHealthChecks(db *mgo.Session) ([]health.Checker, func()) {
-	//dbCheck := sqlhealth.New(db)
-	c := &fakeHealthChecker{}
-	list := []health.Checker{c}
-	return list, func() {
-		//dbCheck.Stop()
-	}
+// appHealthChecks returns the health registry for the database. This will
+// signal to Kubernetes or other orchestrators that the server should not
+// receive traffic until the server is able to connect to its database.
+func appHealthChecks(db *mgo.Session) (*todohealth.Registry, func()) {
+	reg := todohealth.NewRegistry()
+	reg.Register("mongo", &todohealth.MongoChecker{Session: db})
+	return reg, func() {}
 }
 
 // application is the main server struct for Guestbook. It contains the state of
@@ -89,10 +88,12 @@ type application struct {
 	srv        *server.Server
 	grpcServer *grpc.Server
 	db         *mgo.Session
+	health     *todohealth.Registry
 
 	// The following fields are protected by mu:
-	mu   sync.RWMutex
-	motd string // message of the day
+	mu           sync.RWMutex
+	motd         string // message of the day
+	motdReceived bool   // true once watchMOTDVar has applied its first value
 }
 
 // newApplication creates a new application struct based on the backends
@@ -100,16 +101,28 @@ func newApplication(
 	srv *server.Server,
 	db *mgo.Session,
 	grpcServer *grpc.Server,
-	motdVar *runtimevar.Variable) *application {
+	motdVar *runtimevar.Variable,
+	health *todohealth.Registry) *application {
 	app := &application{
 		srv:        srv,
 		grpcServer: grpcServer,
 		db:         db,
+		health:     health,
 	}
+	health.SetReady(app.motdPrimed)
 	go app.watchMOTDVar(motdVar)
 	return app
 }
 
+// motdPrimed reports whether watchMOTDVar has applied at least one value.
+// It backs the health registry's readiness predicate: the app shouldn't
+// receive traffic until the MOTD watcher has caught up.
+func (app *application) motdPrimed() bool {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	return app.motdReceived
+}
+
 // watchMOTDVar listens for changes in v and updates the app's message of the
 // day. It is run in a separate goroutine.
 func (app *application) watchMOTDVar(v *runtimevar.Variable) {
@@ -123,10 +136,45 @@ func (app *application) watchMOTDVar(v *runtimevar.Variable) {
 		log.Println("updated MOTD to", snap.Value)
 		app.mu.Lock()
 		app.motd = snap.Value.(string)
+		app.motdReceived = true
 		app.mu.Unlock()
 	}
 }
 
+// todoPlugin adapts the Mongo-backed todo service to registry.Plugin so
+// start() can wire it up without a dedicated RegisterTodoServiceServer
+// block. It registers itself in init() below.
+type todoPlugin struct {
+	svc *service.TodoService
+}
+
+func (p *todoPlugin) ID() string { return "todo" }
+
+// Init requires a Mongo dependency; it builds the service against the
+// "alex.todo" collection the same way start() used to inline.
+func (p *todoPlugin) Init(ctx context.Context, deps *registry.Deps) (registry.Service, error) {
+	if deps.Mongo == nil {
+		return nil, fmt.Errorf("todo plugin: Mongo dependency is required")
+	}
+	collection := deps.Mongo.DB("alex").C("todo")
+	p.svc = &service.TodoService{Model: &model.TodoModel{Collection: collection}}
+	return registry.NoopService{}, nil
+}
+
+func (p *todoPlugin) RegisterGRPC(server *grpc.Server) {
+	todo.RegisterTodoServiceServer(server, p.svc)
+}
+
+func (p *todoPlugin) RegisterGateway(ctx context.Context, mux *grpc_runtime.ServeMux, conn grpc.ClientConnInterface) error {
+	return todo.RegisterTodoServiceHandler(ctx, mux, conn)
+}
+
+func (p *todoPlugin) HealthCheckers() []gohealth.Checker { return nil }
+
+func init() {
+	registry.Register(&todoPlugin{})
+}
+
 func start(c *cli.Context) {
 	//tracer, closer, err := initTracer(c, logger)
 	//if err != nil {
@@ -152,18 +200,37 @@ func start(c *cli.Context) {
 	}
 	defer cleanup()
 
-	{ // register rpc services
-
-		todoCollection := app.db.DB("alex").C("todo")
-
-		// todo service
-		todoService := &service.TodoService{Model: &model.TodoModel{Collection: todoCollection}}
-		todo.RegisterTodoServiceServer(app.grpcServer, todoService)
-
-		// ... another services ...
+	// Enable the handling-time histogram and pick its buckets before
+	// anything is served, so every method/code pair is exported at 0 from
+	// the first scrape instead of appearing only after first use.
+	buckets := appsrv.DefaultGRPCLatencyBuckets
+	if v := c.String(appsrv.GRPCLatencyBucketsFlagName); v != "" {
+		var berr error
+		buckets, berr = appsrv.ParseLatencyBuckets(v)
+		if berr != nil {
+			log.Fatalf("invalid --%s: %s", appsrv.GRPCLatencyBucketsFlagName, berr)
+		}
 	}
+	grpc_prometheus.EnableHandlingTimeHistogram(grpc_prometheus.WithHistogramBuckets(buckets))
 
-	initPrometheus(c)
+	// Wire every registered plugin's gRPC service and health checkers in one
+	// pass instead of hardcoding a RegisterTodoServiceServer block per
+	// service. Each plugin's Service is kept so its Close can run during
+	// shutdown, same as any other Closer.
+	plugins := registry.All()
+	deps := &registry.Deps{Mongo: app.db}
+	var pluginClosers []appsrv.Closer
+	for _, p := range plugins {
+		svc, err := p.Init(context.Background(), deps)
+		if err != nil {
+			log.Fatalf("plugin %s: %v", p.ID(), err)
+		}
+		pluginClosers = append(pluginClosers, svc)
+		p.RegisterGRPC(app.grpcServer)
+		for i, checker := range p.HealthCheckers() {
+			app.health.Register(fmt.Sprintf("%s-%d", p.ID(), i), checker)
+		}
+	}
 
 	log.Println("Starting Grpc service... " + grpcAddr(c))
 	lis, err := net.Listen("tcp", grpcAddr(c))
@@ -171,38 +238,76 @@ func start(c *cli.Context) {
 		log.Printf("Failed to listen: %v", grpcAddr(c))
 		panic(err)
 	}
-
-	go func() {
-		reflection.Register(app.grpcServer)
-		err := app.grpcServer.Serve(lis)
-		if err != nil {
-			log.Print(err.Error())
-		}
-	}()
+	reflection.Register(app.grpcServer)
+	stopHealth := app.health.RegisterGRPC(app.grpcServer, "todo", 5*time.Second)
+	grpc_prometheus.Register(app.grpcServer)
 
 	mux := grpc_runtime.NewServeMux()
 	{
-		// create grpc client, http gateway will use it
-		conn, err := grpc.Dial(grpcAddr(c), grpc.WithInsecure())
+		// The gateway talks to the gRPC server (and, if --grpc-backends lists
+		// more than one address, its standbys) through a FailoverConnPool
+		// instead of a single grpc.Dial, so a dead primary doesn't take the
+		// HTTP gateway down with it.
+		pool, err := proxy.NewFailoverConnPool(grpcBackends(c), grpc.WithInsecure())
 		if err != nil {
-			log.Printf("Couldn't contact grpc server: " + err.Error())
+			log.Fatalf("Couldn't contact grpc server: %s", err)
 		}
+		prometheus.MustRegister(pool)
 
-		err = todo.RegisterTodoServiceHandler(context.Background(), mux, conn)
-		if err != nil {
-			log.Printf("Cannot serve http api, " + err.Error())
+		for _, p := range plugins {
+			if err := p.RegisterGateway(context.Background(), mux, pool); err != nil {
+				log.Printf("plugin %s: cannot serve http api, %s", p.ID(), err.Error())
+			}
 		}
 	}
 
-	grpc_prometheus.Register(app.grpcServer)
+	promMux := http.NewServeMux()
+	promMux.Handle("/metrics", promhttp.Handler())
+	promMux.Handle("/-/ready", app.health.ReadyHandler())
+	promMux.Handle("/-/healthy", app.health.HealthyHandler())
+
+	servers := &appsrv.Servers{
+		GRPCServer:      app.grpcServer,
+		GRPCListener:    lis,
+		ShutdownTimeout: c.Duration(appsrv.ShutdownTimeoutFlagName),
+		HTTPServers: []*http.Server{
+			{Addr: c.String("bind-prometheus-http"), Handler: promMux},
+			{Addr: httpAddr(c), Handler: mux},
+		},
+		Closers: append(pluginClosers,
+			appsrv.CloserFunc(func() error {
+				app.db.Close()
+				return nil
+			}),
+			appsrv.CloserFunc(func() error {
+				stopHealth()
+				return nil
+			}),
+		),
+	}
+
+	ctx, stop := appsrv.SignalContext()
+	defer stop()
+
 	log.Println("Starting HTTP service... " + httpAddr(c))
-	http.ListenAndServe(httpAddr(c), mux)
+	if err := servers.Run(ctx); err != nil {
+		log.Print(err.Error())
+	}
 }
 
 func grpcAddr(c *cli.Context) string {
 	return "127.0.0.1:" + c.String("bind-grpc")
 }
 
+// grpcBackends returns the addresses the gateway's FailoverConnPool should
+// dial: --grpc-backends, comma-separated, or just grpcAddr(c) if unset.
+func grpcBackends(c *cli.Context) []string {
+	if v := c.String("grpc-backends"); v != "" {
+		return strings.Split(v, ",")
+	}
+	return []string{grpcAddr(c)}
+}
+
 func httpAddr(c *cli.Context) string {
 	return "127.0.0.1:" + c.String("bind-http")
 }
@@ -210,11 +315,3 @@ func httpAddr(c *cli.Context) string {
 func mongoAddr(ctx *cli.Context) string {
 	return ctx.String("db-host") + ":" + ctx.String("db-port")
 }
-
-func initPrometheus(c *cli.Context) {
-	go func() {
-		mux := http.NewServeMux()
-		mux.Handle("/metrics", promhttp.Handler())
-		http.ListenAndServe(c.String("bind-prometheus-http"), mux)
-	}()
-}
@@ -0,0 +1,184 @@
+// Package app provides a shared run/shutdown helper for the todo servers.
+//
+// Every server variant (Postgres-based, Mongo/go-cloud-based) spins up the
+// same shape of listeners: a gRPC server, one or more HTTP servers (gateway,
+// Prometheus), and assorted closers (Jaeger, DB handles). Run wires all of
+// that under a single errgroup so a SIGINT/SIGTERM/SIGHUP drains in-flight
+// RPCs and HTTP requests before the process exits, instead of main()
+// returning out from under them.
+package app
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
+)
+
+// ShutdownTimeoutFlagName is the CLI flag every main.go in this chunk appends
+// to its own flag list so --shutdown-timeout is configurable without each
+// server redeclaring it.
+const ShutdownTimeoutFlagName = "shutdown-timeout"
+
+// DefaultShutdownTimeout bounds how long Run waits for in-flight work to
+// drain once the context is cancelled.
+const DefaultShutdownTimeout = 10 * time.Second
+
+// GRPCLatencyBucketsFlagName is the CLI flag that overrides
+// DefaultGRPCLatencyBuckets, the histogram buckets grpc_prometheus uses for
+// handling-time metrics.
+const GRPCLatencyBucketsFlagName = "grpc-latency-buckets"
+
+// DefaultGRPCLatencyBuckets are the handling-time histogram buckets
+// (seconds) used unless --grpc-latency-buckets is set, from 1ms to 5s.
+var DefaultGRPCLatencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// ParseLatencyBuckets parses a comma-separated --grpc-latency-buckets value
+// (e.g. "0.01,0.05,0.25,1,5") into the []float64 grpc_prometheus expects.
+func ParseLatencyBuckets(s string) ([]float64, error) {
+	fields := strings.Split(s, ",")
+	buckets := make([]float64, 0, len(fields))
+	for _, f := range fields {
+		v, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, v)
+	}
+	return buckets, nil
+}
+
+// Closer is satisfied by *pg.DB and the Jaeger closer directly. Types like
+// *mgo.Session whose Close takes no error use CloserFunc to adapt.
+type Closer interface {
+	Close() error
+}
+
+// CloserFunc adapts a plain func() error, or a no-error Close like
+// *mgo.Session's, into a Closer.
+type CloserFunc func() error
+
+// Close implements Closer.
+func (f CloserFunc) Close() error {
+	return f()
+}
+
+// Servers bundles everything a main.go needs to run and drain cleanly on
+// shutdown.
+type Servers struct {
+	GRPCServer   *grpc.Server
+	GRPCListener net.Listener
+
+	// HTTPServers are shut down with Server.Shutdown(ctx); they typically
+	// hold the gateway mux and the Prometheus mux.
+	HTTPServers []*http.Server
+
+	// ShutdownTimeout is one deadline shared by the whole drain: the grpc
+	// GracefulStop and every HTTPServer's Shutdown must finish within it,
+	// after which gRPC is stopped forcibly and Run returns.
+	ShutdownTimeout time.Duration
+
+	// Closers are closed, in order, once every listener has stopped. A
+	// failing Close is logged but does not stop the others from running.
+	Closers []Closer
+}
+
+// Run starts every listener in Servers and blocks until ctx is cancelled or
+// one of the listeners returns a fatal error, then drains everything and
+// closes the registered Closers. ctx is expected to come from
+// SignalContext.
+func (s *Servers) Run(ctx context.Context) error {
+	if s.ShutdownTimeout <= 0 {
+		s.ShutdownTimeout = DefaultShutdownTimeout
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+
+	g.Go(func() error {
+		return s.GRPCServer.Serve(s.GRPCListener)
+	})
+
+	for _, srv := range s.HTTPServers {
+		srv := srv
+		g.Go(func() error {
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				return err
+			}
+			return nil
+		})
+	}
+
+	<-gctx.Done()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.ShutdownTimeout)
+	defer cancel()
+
+	s.shutdown(shutdownCtx)
+
+	return g.Wait()
+}
+
+// shutdown drains the gRPC server and every HTTP server, then closes the
+// registered Closers. It never returns an error: failures are logged so one
+// slow/broken dependency can't prevent the rest from draining.
+func (s *Servers) shutdown(ctx context.Context) {
+	stopped := make(chan struct{})
+	go func() {
+		s.GRPCServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		log.Warn("grpc graceful stop timed out, forcing Stop")
+		s.GRPCServer.Stop()
+	}
+
+	for _, srv := range s.HTTPServers {
+		if err := srv.Shutdown(ctx); err != nil {
+			log.WithError(err).Warn("http server shutdown error")
+		}
+	}
+
+	for _, c := range s.Closers {
+		if c == nil {
+			continue
+		}
+		if err := c.Close(); err != nil {
+			log.WithError(err).Warn("closer returned error during shutdown")
+		}
+	}
+}
+
+// SignalContext returns a context that is cancelled when the process
+// receives SIGINT, SIGTERM or SIGHUP, plus a stop func to release the
+// signal.Notify registration early (e.g. in tests).
+func SignalContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+
+	go func() {
+		select {
+		case s := <-sig:
+			log.Infof("received %s, draining", s)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(sig)
+		cancel()
+	}
+}
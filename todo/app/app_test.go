@@ -0,0 +1,114 @@
+package app_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/empty"
+	"google.golang.org/grpc"
+
+	"github.com/nizsheanez/monorepo/todo/app"
+)
+
+// echoServiceDesc is a hand-rolled grpc.ServiceDesc for a single
+// server-streaming method, so this test can exercise Servers.Run's drain
+// behavior without a .proto/codegen dependency.
+var echoServiceDesc = grpc.ServiceDesc{
+	ServiceName: "apptest.Echo",
+	HandlerType: (*interface{})(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Echo",
+			ServerStreams: true,
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				h := srv.(*echoHandler)
+				close(h.started)
+				<-h.release
+				return stream.SendMsg(&empty.Empty{})
+			},
+		},
+	},
+}
+
+type echoHandler struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+// TestServersRunDrainsInFlightStream asserts that Run waits for an
+// in-flight streaming RPC to finish sending its response before it returns,
+// rather than cutting it off the moment the context is cancelled.
+func TestServersRunDrainsInFlightStream(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+
+	handler := &echoHandler{started: make(chan struct{}), release: make(chan struct{})}
+	grpcServer := grpc.NewServer()
+	grpcServer.RegisterService(&echoServiceDesc, handler)
+
+	servers := &app.Servers{
+		GRPCServer:      grpcServer,
+		GRPCListener:    lis,
+		ShutdownTimeout: 2 * time.Second,
+	}
+
+	// shutdownCtx only drives Run's shutdown signal; the stream below gets
+	// its own context so cancelling shutdownCtx doesn't also cancel the
+	// client's in-flight RPC and mask what we're testing.
+	shutdownCtx, cancel := context.WithCancel(context.Background())
+	runDone := make(chan error, 1)
+	go func() { runDone <- servers.Run(shutdownCtx) }()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure(), grpc.WithBlock(), grpc.WithTimeout(5*time.Second))
+	if err != nil {
+		t.Fatalf("dial: %s", err)
+	}
+	defer conn.Close()
+
+	stream, err := conn.NewStream(context.Background(), &grpc.StreamDesc{StreamName: "Echo", ServerStreams: true}, "/apptest.Echo/Echo")
+	if err != nil {
+		t.Fatalf("open stream: %s", err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatalf("close send: %s", err)
+	}
+
+	select {
+	case <-handler.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("server never received the streaming RPC")
+	}
+
+	// Trigger shutdown while the RPC is still in flight.
+	cancel()
+
+	select {
+	case err := <-runDone:
+		t.Fatalf("Run returned before the in-flight RPC finished: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	close(handler.release)
+
+	var msg empty.Empty
+	if err := stream.RecvMsg(&msg); err != nil {
+		t.Fatalf("expected the in-flight RPC's response, got: %s", err)
+	}
+	if err := stream.RecvMsg(&msg); err != io.EOF {
+		t.Fatalf("expected io.EOF after the response, got: %v", err)
+	}
+
+	select {
+	case err := <-runDone:
+		if err != nil {
+			t.Fatalf("Run: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run never returned after the in-flight RPC completed")
+	}
+}
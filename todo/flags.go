@@ -0,0 +1,84 @@
+package main
+
+import (
+	"github.com/urfave/cli"
+
+	"github.com/nizsheanez/monorepo/todo/app"
+)
+
+// commonFlags is app.Flags for this server. It was missing from this
+// snapshot; add new flags here rather than reading an unregistered
+// c.String/c.Duration, which urfave/cli silently returns as the zero value.
+var commonFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "bind-grpc",
+		Value: "127.0.0.1:8081",
+		Usage: "address the gRPC server listens on",
+	},
+	cli.StringFlag{
+		Name:  "bind-http",
+		Value: "127.0.0.1:8080",
+		Usage: "address the grpc-gateway HTTP server listens on",
+	},
+	cli.StringFlag{
+		Name:  "bind-prometheus-http",
+		Value: "127.0.0.1:9090",
+		Usage: "address the Prometheus metrics/health HTTP server listens on",
+	},
+	cli.StringFlag{
+		Name:  "grpc-backends",
+		Usage: "comma-separated backend addresses the HTTP gateway's FailoverConnPool dials, defaults to bind-grpc",
+	},
+	cli.DurationFlag{
+		Name:  app.ShutdownTimeoutFlagName,
+		Value: app.DefaultShutdownTimeout,
+		Usage: "how long to wait for in-flight work to drain on shutdown",
+	},
+	cli.StringFlag{
+		Name:  app.GRPCLatencyBucketsFlagName,
+		Usage: "comma-separated gRPC handling-time histogram buckets in seconds, defaults to 0.001,0.005,0.01,0.025,0.05,0.1,0.25,0.5,1,2.5,5",
+	},
+	cli.StringFlag{
+		Name:  "db-host",
+		Value: "127.0.0.1",
+		Usage: "PostgreSQL host",
+	},
+	cli.StringFlag{
+		Name:  "db-port",
+		Value: "5432",
+		Usage: "PostgreSQL port",
+	},
+	cli.StringFlag{
+		Name:  "db-user",
+		Value: "postgres",
+		Usage: "PostgreSQL user",
+	},
+	cli.StringFlag{
+		Name:  "db-password",
+		Usage: "PostgreSQL password",
+	},
+	cli.StringFlag{
+		Name:  "db-name",
+		Value: "todo",
+		Usage: "PostgreSQL database name",
+	},
+	cli.StringFlag{
+		Name:  "jaeger-host",
+		Value: "127.0.0.1",
+		Usage: "Jaeger agent host",
+	},
+	cli.StringFlag{
+		Name:  "jaeger-port",
+		Value: "6831",
+		Usage: "Jaeger agent port",
+	},
+	cli.Float64Flag{
+		Name:  "jaeger-sampler",
+		Value: 0.001,
+		Usage: "initial sampling rate, used until the first strategy is fetched from /sampling",
+	},
+	cli.StringFlag{
+		Name:  "sampling-strategies-file",
+		Usage: "path to a Jaeger per-operation sampling strategies JSON file, reloaded on change",
+	},
+}
@@ -0,0 +1,170 @@
+// Package health provides the concrete health.Checker implementations and
+// the registry that backs /-/ready, /-/healthy and the grpc_health_v1
+// service for the todo servers. Each backend (Mongo, Postgres) gets its own
+// Checker; the Registry aggregates them so a single grpc_health_v1.Server
+// and a pair of HTTP handlers can speak for all of them.
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/go-pg/pg"
+	gohealth "github.com/google/go-cloud/health"
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// MongoChecker reports unhealthy whenever the session can't be pinged.
+type MongoChecker struct {
+	Session *mgo.Session
+}
+
+// CheckHealth implements gohealth.Checker.
+func (c *MongoChecker) CheckHealth() error {
+	return c.Session.Ping()
+}
+
+// PostgresChecker reports unhealthy whenever the database can't be pinged.
+type PostgresChecker struct {
+	DB *pg.DB
+}
+
+// CheckHealth implements gohealth.Checker.
+func (c *PostgresChecker) CheckHealth() error {
+	return c.DB.Ping(context.Background())
+}
+
+// Registry aggregates named checkers, remembers each one's last result, and
+// serves that state over grpc_health_v1 as well as plain HTTP.
+type Registry struct {
+	mu       sync.RWMutex
+	checkers map[string]gohealth.Checker
+	lastErr  map[string]error
+
+	// ready, when set, gates /-/ready independently of the checkers (e.g.
+	// "has the MOTD watcher received its first value yet").
+	ready func() bool
+}
+
+// NewRegistry returns an empty Registry. Use Register to add checkers and
+// SetReady to gate readiness on more than "every checker currently passes".
+func NewRegistry() *Registry {
+	return &Registry{
+		checkers: make(map[string]gohealth.Checker),
+		lastErr:  make(map[string]error),
+	}
+}
+
+// Register adds a named checker. name shows up as the failing checker name
+// in /-/ready and /-/healthy; grpc_health_v1 reports all checkers together
+// under the serviceName given to RegisterGRPC.
+func (r *Registry) Register(name string, c gohealth.Checker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkers[name] = c
+}
+
+// SetReady installs the extra readiness predicate used by /-/ready.
+func (r *Registry) SetReady(ready func() bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ready = ready
+}
+
+// runAll runs every checker, records the result and returns a copy of the
+// failures (nil errors are omitted).
+func (r *Registry) runAll() map[string]error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	failures := make(map[string]error)
+	for name, c := range r.checkers {
+		err := c.CheckHealth()
+		r.lastErr[name] = err
+		if err != nil {
+			failures[name] = err
+		}
+	}
+	return failures
+}
+
+// isReady reports whether the optional extra predicate allows traffic.
+func (r *Registry) isReady() bool {
+	r.mu.RLock()
+	ready := r.ready
+	r.mu.RUnlock()
+	return ready == nil || ready()
+}
+
+// ReadyHandler serves /-/ready: 200 once the ready predicate (if any) is
+// satisfied and every checker passes a fresh run, 503 otherwise.
+func (r *Registry) ReadyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if !r.isReady() {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		for name, err := range r.runAll() {
+			http.Error(w, name+": "+err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// HealthyHandler serves /-/healthy: 503 with the failing checker's name if
+// any checker's last recorded result is an error, 200 otherwise. Unlike
+// ReadyHandler it never triggers a fresh run, so it stays cheap to poll.
+func (r *Registry) HealthyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		for name, err := range r.lastErr {
+			if err != nil {
+				http.Error(w, name+": "+err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// RegisterGRPC registers a grpc_health_v1.HealthServer on grpcServer and
+// keeps its serving status for serviceName in sync by re-running every
+// checker on interval, so Kubernetes/Envoy can probe the service with
+// Check/Watch. It returns a stop func to release the background goroutine.
+func (r *Registry) RegisterGRPC(grpcServer *grpc.Server, serviceName string, interval time.Duration) func() {
+	srv := grpchealth.NewServer()
+	grpc_health_v1.RegisterHealthServer(grpcServer, srv)
+
+	setStatus := func() {
+		status := grpc_health_v1.HealthCheckResponse_SERVING
+		if failures := r.runAll(); len(failures) > 0 {
+			status = grpc_health_v1.HealthCheckResponse_NOT_SERVING
+		}
+		srv.SetServingStatus(serviceName, status)
+	}
+	// Run once before the ticker starts so Check/Watch see a real
+	// SERVING/NOT_SERVING status immediately, instead of the health
+	// server's default NOT_FOUND for the first interval.
+	setStatus()
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				setStatus()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"path"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/go-pg/pg"
@@ -18,6 +19,7 @@ import (
 	"github.com/grpc-ecosystem/go-grpc-middleware/tracing/opentracing"
 	"github.com/grpc-ecosystem/go-grpc-prometheus"
 	grpc_runtime "github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
 	"github.com/uber/jaeger-client-go/config"
@@ -28,8 +30,16 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
+	gohealth "github.com/google/go-cloud/health"
+
+	"github.com/nizsheanez/monorepo/todo/app"
 	todoV1 "github.com/nizsheanez/monorepo/todo/client"
 	todo "github.com/nizsheanez/monorepo/todo/client/v2"
+	todohealth "github.com/nizsheanez/monorepo/todo/health"
+	"github.com/nizsheanez/monorepo/todo/pkg/grpcerrors"
+	"github.com/nizsheanez/monorepo/todo/proxy"
+	"github.com/nizsheanez/monorepo/todo/service/registry"
+	"github.com/nizsheanez/monorepo/todo/tracing/sampling"
 )
 
 func main() {
@@ -53,6 +63,41 @@ var panicHandler = grpc_recovery.RecoveryHandlerFunc(func(p interface{}) error {
 	return status.Errorf(codes.Internal, "%s", p)
 })
 
+// postgresPlugin adapts the Postgres-backed todo service to registry.Plugin
+// so start() can wire it up through the same registry.All() loop as the
+// Mongo-backed server in src/todo/main.go, instead of a hardcoded
+// RegisterTodoServiceServer call. It registers itself in init() below.
+type postgresPlugin struct {
+	svc *todoV1.Service
+}
+
+func (p *postgresPlugin) ID() string { return "todo" }
+
+// Init requires a Postgres dependency; it creates the Todo table the same
+// way start() used to inline.
+func (p *postgresPlugin) Init(ctx context.Context, deps *registry.Deps) (registry.Service, error) {
+	if deps.Postgres == nil {
+		return nil, fmt.Errorf("todo plugin: Postgres dependency is required")
+	}
+	deps.Postgres.CreateTable(&todo.Todo{}, nil)
+	p.svc = &todoV1.Service{DB: deps.Postgres}
+	return registry.NoopService{}, nil
+}
+
+func (p *postgresPlugin) RegisterGRPC(server *grpc.Server) {
+	todoV1.RegisterTodoServiceServer(server, p.svc)
+}
+
+func (p *postgresPlugin) RegisterGateway(ctx context.Context, mux *grpc_runtime.ServeMux, conn grpc.ClientConnInterface) error {
+	return todoV1.RegisterTodoServiceHandler(ctx, mux, conn)
+}
+
+func (p *postgresPlugin) HealthCheckers() []gohealth.Checker { return nil }
+
+func init() {
+	registry.Register(&postgresPlugin{})
+}
+
 func start(c *cli.Context) {
 	lis, err := net.Listen("tcp", c.String("bind-grpc"))
 	if err != nil {
@@ -67,11 +112,30 @@ func start(c *cli.Context) {
 	// Prometheus monitoring
 	metrics := prometheus_metrics.New()
 
+	// Remote sampling strategies: load from --sampling-strategies-file and
+	// keep reloading it on change, so operators don't have to restart every
+	// client of the todo service just to change its sampling rate.
+	samplingStore := sampling.NewStore()
+	stopSamplingWatch := func() {}
+	if f := c.String("sampling-strategies-file"); f != "" {
+		if err := samplingStore.LoadFile(f); err != nil {
+			logger.Fatalf("Cannot load sampling strategies file %s: %s", f, err)
+		}
+		stop, err := samplingStore.WatchFile(f)
+		if err != nil {
+			logger.Fatalf("Cannot watch sampling strategies file %s: %s", f, err)
+		}
+		stopSamplingWatch = stop
+	}
+	prometheus.MustRegister(samplingStore)
+	samplingServerURL := "http://" + c.String("bind-prometheus-http") + "/sampling"
+
 	// Jaeger tracing
 	cfg := config.Configuration{
 		Sampler: &config.SamplerConfig{
-			Type:  "const",
-			Param: c.Float64("jaeger-sampler"),
+			Type:              "remote",
+			Param:             c.Float64("jaeger-sampler"),
+			SamplingServerURL: samplingServerURL,
 		},
 		Reporter: &config.ReporterConfig{
 			LocalAgentHostPort: c.String("jaeger-host") + ":" + c.String("jaeger-port"),
@@ -85,7 +149,18 @@ func start(c *cli.Context) {
 	if err != nil {
 		logger.Fatalf("Cannot initialize Jaeger Tracer %s", err)
 	}
-	defer closer.Close()
+
+	// Enable the handling-time histogram and pick its buckets before the
+	// server (and therefore the grpc_prometheus interceptors) is built, so
+	// every method/code pair is exported at 0 from the first scrape.
+	buckets := app.DefaultGRPCLatencyBuckets
+	if v := c.String(app.GRPCLatencyBucketsFlagName); v != "" {
+		buckets, err = app.ParseLatencyBuckets(v)
+		if err != nil {
+			logger.Fatalf("invalid --%s: %s", app.GRPCLatencyBucketsFlagName, err)
+		}
+	}
+	grpc_prometheus.EnableHandlingTimeHistogram(grpc_prometheus.WithHistogramBuckets(buckets))
 
 	// Set GRPC Interceptors
 	server := grpc.NewServer(
@@ -95,6 +170,7 @@ func start(c *cli.Context) {
 			grpc_prometheus.StreamServerInterceptor,
 			grpc_logrus.StreamServerInterceptor(logger),
 			grpc_recovery.StreamServerInterceptor(grpc_recovery.WithRecoveryHandler(panicHandler)),
+			grpcerrors.StreamServerInterceptor(),
 		)),
 		grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(
 			grpc_ctxtags.UnaryServerInterceptor(grpc_ctxtags.WithFieldExtractor(grpc_ctxtags.CodeGenRequestFieldExtractor)),
@@ -102,6 +178,7 @@ func start(c *cli.Context) {
 			grpc_prometheus.UnaryServerInterceptor,
 			grpc_logrus.UnaryServerInterceptor(logger),
 			grpc_recovery.UnaryServerInterceptor(grpc_recovery.WithRecoveryHandler(panicHandler)),
+			grpcerrors.UnaryServerInterceptor(),
 		)),
 	)
 
@@ -116,33 +193,81 @@ func start(c *cli.Context) {
 		MinRetryBackoff:       250 * time.Millisecond,
 	})
 
-	// Create Table from Todo struct generated by gRPC
-	db.CreateTable(&todo.Todo{}, nil)
-
-	// Register Todo service, prometheus and HTTP service handler
-	//api.RegisterTodoServiceServer(server, &todo.Service{DB: db})
+	// Wire every registered plugin's gRPC service in one pass instead of a
+	// hardcoded RegisterTodoServiceServer call. Each plugin's Service is
+	// kept so its Close can run during shutdown, same as any other Closer.
+	plugins := registry.All()
+	deps := &registry.Deps{Postgres: db}
+	var pluginClosers []app.Closer
+	for _, p := range plugins {
+		svc, err := p.Init(context.Background(), deps)
+		if err != nil {
+			logger.Fatalf("plugin %s: %s", p.ID(), err)
+		}
+		pluginClosers = append(pluginClosers, svc)
+		p.RegisterGRPC(server)
+	}
+	health := todohealth.NewRegistry()
+	health.Register("postgres", &todohealth.PostgresChecker{DB: db})
+	stopHealth := health.RegisterGRPC(server, "todo", 5*time.Second)
 	grpc_prometheus.Register(server)
 
-	go func() {
-		mux := http.NewServeMux()
-		mux.Handle("/metrics", promhttp.Handler())
-		http.ListenAndServe(c.String("bind-prometheus-http"), mux)
-	}()
-
-	log.Println("Starting Todo service..")
-	go server.Serve(lis)
+	promMux := http.NewServeMux()
+	promMux.Handle("/metrics", promhttp.Handler())
+	promMux.Handle("/-/ready", health.ReadyHandler())
+	promMux.Handle("/-/healthy", health.HealthyHandler())
+	promMux.Handle("/sampling", samplingStore.Handler())
 
-	conn, err := grpc.Dial(c.String("bind-grpc"), grpc.WithInsecure())
+	// The gateway talks to the gRPC server (and, if --grpc-backends lists
+	// more than one address, its standbys) through a FailoverConnPool
+	// instead of a single grpc.Dial, so a dead primary doesn't take the
+	// HTTP gateway down with it.
+	pool, err := proxy.NewFailoverConnPool(grpcBackends(c), grpc.WithInsecure())
 	if err != nil {
 		panic("Couldn't contact grpc server")
 	}
+	prometheus.MustRegister(pool)
 
-	mux := grpc_runtime.NewServeMux()
-	err = api.RegisterTodoServiceHandler(context.Background(), mux, conn)
-	if err != nil {
-		panic("Cannot serve http api")
+	gatewayMux := grpc_runtime.NewServeMux()
+	for _, p := range plugins {
+		if err := p.RegisterGateway(context.Background(), gatewayMux, pool); err != nil {
+			logger.Fatalf("plugin %s: cannot serve http api: %s", p.ID(), err)
+		}
+	}
+
+	servers := &app.Servers{
+		GRPCServer:      server,
+		GRPCListener:    lis,
+		ShutdownTimeout: c.Duration(app.ShutdownTimeoutFlagName),
+		HTTPServers: []*http.Server{
+			{Addr: c.String("bind-prometheus-http"), Handler: promMux},
+			{Addr: c.String("bind-http"), Handler: gatewayMux},
+		},
+		Closers: append(pluginClosers, closer, db, app.CloserFunc(func() error {
+			stopHealth()
+			return nil
+		}), app.CloserFunc(func() error {
+			stopSamplingWatch()
+			return nil
+		})),
+	}
+
+	ctx, stop := app.SignalContext()
+	defer stop()
+
+	log.Println("Starting Todo service..")
+	if err := servers.Run(ctx); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// grpcBackends returns the addresses the gateway's FailoverConnPool should
+// dial: --grpc-backends, comma-separated, or just bind-grpc if unset.
+func grpcBackends(c *cli.Context) []string {
+	if v := c.String("grpc-backends"); v != "" {
+		return strings.Split(v, ",")
 	}
-	http.ListenAndServe(c.String("bind-http"), mux)
+	return []string{c.String("bind-grpc")}
 }
 
 type jaegerLoggerAdapter struct {
@@ -0,0 +1,166 @@
+// Package grpcerrors translates domain errors returned by the model layer
+// into gRPC statuses (and back again on the client), so callers can use
+// errors.Is against a small set of sentinels instead of switching on
+// codes.Code or parsing status messages.
+package grpcerrors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Sentinel errors the model layer returns and that callers can match with
+// errors.Is(err, grpcerrors.ErrNotFound) etc., on either side of the wire.
+var (
+	ErrNotFound        = errors.New("grpcerrors: not found")
+	ErrAlreadyExists   = errors.New("grpcerrors: already exists")
+	ErrInvalidArgument = errors.New("grpcerrors: invalid argument")
+	ErrPermission      = errors.New("grpcerrors: permission denied")
+)
+
+// sentinelCodes maps each sentinel to the gRPC code it should translate to,
+// and reasons to the stable ErrorInfo.Reason string advertised for it.
+var sentinelCodes = map[error]codes.Code{
+	ErrNotFound:        codes.NotFound,
+	ErrAlreadyExists:   codes.AlreadyExists,
+	ErrInvalidArgument: codes.InvalidArgument,
+	ErrPermission:      codes.PermissionDenied,
+}
+
+var sentinelReasons = map[error]string{
+	ErrNotFound:        "NOT_FOUND",
+	ErrAlreadyExists:   "ALREADY_EXISTS",
+	ErrInvalidArgument: "INVALID_ARGUMENT",
+	ErrPermission:      "PERMISSION_DENIED",
+}
+
+var reasonSentinels = map[string]error{
+	"NOT_FOUND":         ErrNotFound,
+	"ALREADY_EXISTS":    ErrAlreadyExists,
+	"INVALID_ARGUMENT":  ErrInvalidArgument,
+	"PERMISSION_DENIED": ErrPermission,
+}
+
+// errorInfoDomain is the ErrorInfo.Domain advertised on every translated
+// status, so clients of other services can tell todo's reasons apart from
+// their own.
+const errorInfoDomain = "todo.nizsheanez.monorepo"
+
+// wrappedError is what Wrap returns: a sentinel plus the gRPC code/message/
+// details the server interceptor should translate it to.
+type wrappedError struct {
+	sentinel error
+	code     codes.Code
+	msg      string
+	details  []proto.Message
+}
+
+func (w *wrappedError) Error() string { return w.msg }
+func (w *wrappedError) Unwrap() error { return w.sentinel }
+
+// Wrap attaches a gRPC code, a message and optional detail messages (e.g.
+// *errdetails.ErrorInfo, *errdetails.BadRequest) to sentinel, for a
+// model-layer function to return directly. The server interceptor below
+// recognizes it and translates it; callers that don't need the extra
+// details can keep returning a plain sentinel and still get translated via
+// errors.Is.
+func Wrap(sentinel error, code codes.Code, msg string, details ...proto.Message) error {
+	return &wrappedError{sentinel: sentinel, code: code, msg: msg, details: details}
+}
+
+// translate turns a domain error into a *status.Status carrying an
+// ErrorInfo with a stable Reason. Errors that aren't sentinels or Wrap
+// results are returned unchanged and not logged (gRPC reports a plain error
+// as codes.Unknown). A translated error is logged at Debug first so the
+// real cause isn't lost behind the gRPC status.
+func translate(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var we *wrappedError
+	if errors.As(err, &we) {
+		log.WithError(we.sentinel).Debugf("grpcerrors: translating %q", we.msg)
+		reason := sentinelReasons[we.sentinel]
+		details := append([]proto.Message{&errdetails.ErrorInfo{Reason: reason, Domain: errorInfoDomain}}, we.details...)
+		st, serr := status.New(we.code, we.msg).WithDetails(details...)
+		if serr != nil {
+			return status.Error(we.code, we.msg)
+		}
+		return st.Err()
+	}
+
+	for sentinel, code := range sentinelCodes {
+		if !errors.Is(err, sentinel) {
+			continue
+		}
+		log.WithError(err).Debugf("grpcerrors: translating sentinel error")
+		info := &errdetails.ErrorInfo{Reason: sentinelReasons[sentinel], Domain: errorInfoDomain}
+		st, serr := status.New(code, err.Error()).WithDetails(info)
+		if serr != nil {
+			return status.Error(code, err.Error())
+		}
+		return st.Err()
+	}
+
+	return err
+}
+
+// UnaryServerInterceptor translates errors returned by unary handlers. It
+// chains into the existing grpc_middleware.ChainUnaryServer list.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		return resp, translate(err)
+	}
+}
+
+// StreamServerInterceptor translates errors returned by streaming handlers.
+// It chains into the existing grpc_middleware.ChainStreamServer list.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return translate(handler(srv, ss))
+	}
+}
+
+// UnaryClientInterceptor unpacks the ErrorInfo reason from a failed call's
+// status and re-wraps it into the matching sentinel via %w, so callers can
+// write errors.Is(err, grpcerrors.ErrNotFound) regardless of which process
+// the error originated in.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		return unwrapClientError(err)
+	}
+}
+
+func unwrapClientError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+
+	for _, d := range st.Details() {
+		info, ok := d.(*errdetails.ErrorInfo)
+		if !ok {
+			continue
+		}
+		if sentinel, ok := reasonSentinels[info.Reason]; ok {
+			return fmt.Errorf("%s: %w", st.Message(), sentinel)
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,187 @@
+// Package proxy provides a gRPC client connection that fails over between
+// multiple backend addresses. It exists because the HTTP gateway (and the
+// CLI client) used to grpc.Dial a single backend and panic the moment that
+// backend died; FailoverConnPool instead keeps a pool of backends and only
+// switches "primary" when a call actually fails against it.
+package proxy
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// healthCheckTimeout bounds how long promote waits for a candidate
+// backend's grpc_health_v1.Check before trying the next one.
+const healthCheckTimeout = 2 * time.Second
+
+// FailoverConnPool implements grpc.ClientConnInterface over a list of
+// backend addresses. Every Invoke/NewStream is delegated to the current
+// primary connection; if that call fails with codes.Unavailable or the
+// connection is TRANSIENT_FAILURE, the pool lazily promotes the next
+// backend whose grpc_health_v1.Check reports SERVING and retries once
+// against it. Promotion only happens inline with a failing call, never on
+// a background timer.
+type FailoverConnPool struct {
+	dialOpts []grpc.DialOption
+
+	mu       sync.Mutex
+	backends []string
+	conns    map[string]*grpc.ClientConn
+	primary  int
+
+	failoverTotal *prometheus.CounterVec
+}
+
+// NewFailoverConnPool dials backends[0] and returns a pool that will fail
+// over to the rest of backends on demand. Remaining backends are dialed
+// lazily, only when a promotion needs them.
+func NewFailoverConnPool(backends []string, dialOpts ...grpc.DialOption) (*FailoverConnPool, error) {
+	if len(backends) == 0 {
+		return nil, errors.New("proxy: at least one backend is required")
+	}
+
+	p := &FailoverConnPool{
+		dialOpts: dialOpts,
+		backends: backends,
+		conns:    make(map[string]*grpc.ClientConn),
+		failoverTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "todo_proxy_failover_total",
+			Help: "Count of FailoverConnPool primary promotions, by from, to and reason.",
+		}, []string{"from", "to", "reason"}),
+	}
+
+	if _, err := p.connFor(backends[0]); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *FailoverConnPool) connFor(addr string) (*grpc.ClientConn, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.connForLocked(addr)
+}
+
+func (p *FailoverConnPool) connForLocked(addr string) (*grpc.ClientConn, error) {
+	if conn, ok := p.conns[addr]; ok {
+		return conn, nil
+	}
+	conn, err := grpc.Dial(addr, p.dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+	p.conns[addr] = conn
+	return conn, nil
+}
+
+func (p *FailoverConnPool) primaryAddr() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.backends[p.primary]
+}
+
+// Invoke implements grpc.ClientConnInterface.
+func (p *FailoverConnPool) Invoke(ctx context.Context, method string, args, reply interface{}, opts ...grpc.CallOption) error {
+	addr := p.primaryAddr()
+	conn, err := p.connFor(addr)
+	if err != nil {
+		return err
+	}
+
+	err = conn.Invoke(ctx, method, args, reply, opts...)
+	if reason, failover := p.failoverReason(conn, err); failover {
+		if newConn, ok := p.promote(addr, reason); ok {
+			return newConn.Invoke(ctx, method, args, reply, opts...)
+		}
+	}
+	return err
+}
+
+// NewStream implements grpc.ClientConnInterface.
+func (p *FailoverConnPool) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	addr := p.primaryAddr()
+	conn, err := p.connFor(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := conn.NewStream(ctx, desc, method, opts...)
+	if reason, failover := p.failoverReason(conn, err); failover {
+		if newConn, ok := p.promote(addr, reason); ok {
+			return newConn.NewStream(ctx, desc, method, opts...)
+		}
+	}
+	return stream, err
+}
+
+// failoverReason reports whether conn looks bad enough to promote away
+// from, and why.
+func (p *FailoverConnPool) failoverReason(conn *grpc.ClientConn, err error) (string, bool) {
+	if status.Code(err) == codes.Unavailable {
+		return "unavailable", true
+	}
+	if conn.GetState() == connectivity.TransientFailure {
+		return "transient_failure", true
+	}
+	return "", false
+}
+
+// promote advances the primary, in backend order starting after from, to
+// the first candidate whose grpc_health_v1.Check reports SERVING. It
+// records a todo_proxy_failover_total sample on success.
+//
+// Health-checking candidates runs without p.mu held, so a promotion in
+// progress (up to healthCheckTimeout per candidate) never blocks concurrent
+// Invoke/NewStream calls against the still-current primary. p.mu is held
+// only to copy the backend list, to look up or grpc.Dial a candidate's
+// connection in connFor, and to commit the new primary index.
+func (p *FailoverConnPool) promote(from, reason string) (*grpc.ClientConn, bool) {
+	p.mu.Lock()
+	n := len(p.backends)
+	start := p.primary
+	backends := make([]string, n)
+	copy(backends, p.backends)
+	p.mu.Unlock()
+
+	for i := 1; i < n; i++ {
+		idx := (start + i) % n
+		addr := backends[idx]
+		conn, err := p.connFor(addr)
+		if err != nil {
+			continue
+		}
+		if !p.isServing(conn) {
+			continue
+		}
+
+		p.mu.Lock()
+		p.primary = idx
+		p.failoverTotal.WithLabelValues(from, addr, reason).Inc()
+		p.mu.Unlock()
+		return conn, true
+	}
+	return nil, false
+}
+
+func (p *FailoverConnPool) isServing(conn *grpc.ClientConn) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+	resp, err := grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	return err == nil && resp.Status == grpc_health_v1.HealthCheckResponse_SERVING
+}
+
+// Describe implements prometheus.Collector so the pool's failover counter
+// can be registered alongside the process's other metrics.
+func (p *FailoverConnPool) Describe(ch chan<- *prometheus.Desc) { p.failoverTotal.Describe(ch) }
+
+// Collect implements prometheus.Collector.
+func (p *FailoverConnPool) Collect(ch chan<- prometheus.Metric) { p.failoverTotal.Collect(ch) }
@@ -0,0 +1,101 @@
+// Package registry is a small plugin loader, modeled on containerd's, that
+// lets each gRPC service (todo, projects, ...) register itself in init()
+// instead of main.go hardcoding a RegisterTodoServiceServer/
+// RegisterTodoServiceHandler block per service. main.go just walks
+// registry.All() once to wire gRPC, the gateway and health in one pass.
+package registry
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/globalsign/mgo"
+	"github.com/go-pg/pg"
+	gohealth "github.com/google/go-cloud/health"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/grpc"
+)
+
+// Deps is the typed dependency container a Plugin's Init draws from. Every
+// field is optional: a plugin that needs Mongo reads deps.Mongo and errors
+// out of Init if it's nil, same for Postgres, rather than the registry
+// trying to guess which backends a plugin wants.
+type Deps struct {
+	Mongo    *mgo.Session
+	Postgres *pg.DB
+}
+
+// Service is what a Plugin's Init returns. Close releases anything the
+// plugin opened (collections, prepared statements, ...); plugins with
+// nothing to release can return NoopService{}.
+type Service interface {
+	Close() error
+}
+
+// NoopService is a Service with nothing to release.
+type NoopService struct{}
+
+// Close implements Service.
+func (NoopService) Close() error { return nil }
+
+// Plugin is implemented by each gRPC service this monorepo exposes. A
+// plugin registers itself in its own init() via Register so adding a new
+// service no longer means editing every main.go's start().
+type Plugin interface {
+	// ID names the plugin, e.g. "todo" or "projects". Registering two
+	// plugins with the same ID panics.
+	ID() string
+
+	// Init builds the service implementation from deps. It is called once,
+	// before RegisterGRPC/RegisterGateway.
+	Init(ctx context.Context, deps *Deps) (Service, error)
+
+	// RegisterGRPC registers the service on the gRPC server.
+	RegisterGRPC(*grpc.Server)
+
+	// RegisterGateway registers the grpc-gateway HTTP handlers for the
+	// service against conn, the client connection to the gRPC server. conn
+	// is a grpc.ClientConnInterface rather than a concrete *grpc.ClientConn
+	// so callers can pass a proxy.FailoverConnPool in its place.
+	RegisterGateway(ctx context.Context, mux *runtime.ServeMux, conn grpc.ClientConnInterface) error
+
+	// HealthCheckers returns the checkers this plugin wants included in the
+	// process-wide health registry, or nil if it has none of its own.
+	HealthCheckers() []gohealth.Checker
+}
+
+var (
+	mu   sync.Mutex
+	byID = map[string]Plugin{}
+	// order preserves registration order so wiring (and any logs about it)
+	// is deterministic across runs.
+	order []string
+)
+
+// Register adds p to the registry. It is meant to be called from a
+// plugin's init(), and panics on a duplicate ID since that means two
+// services were compiled in under the same name.
+func Register(p Plugin) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	id := p.ID()
+	if _, exists := byID[id]; exists {
+		panic(fmt.Sprintf("registry: plugin %q already registered", id))
+	}
+	byID[id] = p
+	order = append(order, id)
+}
+
+// All returns every registered plugin in registration order.
+func All() []Plugin {
+	mu.Lock()
+	defer mu.Unlock()
+
+	plugins := make([]Plugin, len(order))
+	for i, id := range order {
+		plugins[i] = byID[id]
+	}
+	return plugins
+}
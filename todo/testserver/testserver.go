@@ -0,0 +1,217 @@
+// Package testserver spins up the gRPC + gateway stack the way the
+// production main.go files do, against an ephemeral Mongo instance, so
+// service tests don't each have to re-derive the interceptor chain and
+// wiring order. Use New to start one per test.
+package testserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/globalsign/mgo"
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	grpc_logrus "github.com/grpc-ecosystem/go-grpc-middleware/logging/logrus"
+	grpc_recovery "github.com/grpc-ecosystem/go-grpc-middleware/recovery"
+	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
+	grpc_opentracing "github.com/grpc-ecosystem/go-grpc-middleware/tracing/opentracing"
+	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
+	grpc_runtime "github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/ory/dockertest"
+	log "github.com/sirupsen/logrus"
+	"github.com/uber/jaeger-client-go"
+
+	"github.com/nizsheanez/monorepo/todo/projects"
+	"github.com/nizsheanez/monorepo/todo/service/registry"
+	"github.com/nizsheanez/monorepo/todo/todo"
+	"google.golang.org/grpc"
+)
+
+// Option configures New. The zero value (no options) starts a server with
+// every plugin registered via registry.Register.
+type Option func(*config)
+
+type config struct {
+	plugins    []registry.Plugin
+	restricted bool
+}
+
+// WithPlugin restricts the TestServer to plugin, instead of every plugin
+// registry.Register has accumulated. Pass it once per plugin to opt a test
+// into a handful of services rather than the whole monorepo; the first
+// WithPlugin in a New call discards the registry.All() default so plugins
+// aren't registered twice under the same ID.
+func WithPlugin(plugin registry.Plugin) Option {
+	return func(cfg *config) {
+		if !cfg.restricted {
+			cfg.plugins = nil
+			cfg.restricted = true
+		}
+		cfg.plugins = append(cfg.plugins, plugin)
+	}
+}
+
+// TestServer is a running gRPC+gateway stack backed by an ephemeral Mongo
+// container. Both its gRPC and HTTP addresses are ephemeral, so many
+// TestServers can run in parallel without port collisions.
+type TestServer struct {
+	GRPCConn *grpc.ClientConn
+	HTTPURL  string
+
+	Todo     todo.ApiClient
+	Projects projects.ApiClient
+
+	grpcServer   *grpc.Server
+	grpcListener net.Listener
+	httpServer   *httptest.Server
+	db           *mgo.Session
+}
+
+// New starts a TestServer and registers t.Cleanup to tear it down: the
+// gateway, the gRPC server, and the Mongo container are stopped in reverse
+// order of being started.
+func New(t *testing.T, opts ...Option) *TestServer {
+	t.Helper()
+
+	cfg := &config{plugins: registry.All()}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	ts := &TestServer{}
+	ts.startMongo(t)
+	ts.startGRPC(t, cfg.plugins)
+	ts.startGateway(t, cfg.plugins)
+
+	conn, err := grpc.Dial(ts.grpcListener.Addr().String(), grpc.WithInsecure(), grpc.WithBlock(), grpc.WithTimeout(5*time.Second))
+	if err != nil {
+		t.Fatalf("testserver: dial grpc: %s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	ts.GRPCConn = conn
+	ts.Todo = todo.NewApiClient(conn)
+	ts.Projects = projects.NewApiClient(conn)
+
+	return ts
+}
+
+// startMongo runs a mongo:4 container via dockertest and dials it,
+// retrying until the container accepts connections.
+func (ts *TestServer) startMongo(t *testing.T) {
+	t.Helper()
+
+	pool, err := dockertest.NewPool("")
+	if err != nil {
+		t.Fatalf("testserver: dockertest pool: %s", err)
+	}
+	resource, err := pool.Run("mongo", "4", nil)
+	if err != nil {
+		t.Fatalf("testserver: start mongo container: %s", err)
+	}
+	t.Cleanup(func() {
+		if err := pool.Purge(resource); err != nil {
+			log.WithError(err).Warn("testserver: purge mongo container")
+		}
+	})
+
+	addr := fmt.Sprintf("localhost:%s", resource.GetPort("27017/tcp"))
+	if err := pool.Retry(func() error {
+		session, err := mgo.Dial(addr)
+		if err != nil {
+			return err
+		}
+		ts.db = session
+		return session.Ping()
+	}); err != nil {
+		t.Fatalf("testserver: mongo never became reachable: %s", err)
+	}
+	t.Cleanup(func() { ts.db.Close() })
+}
+
+// startGRPC builds a gRPC server with the interceptor chain production uses
+// (ctxtags, opentracing, prometheus, logrus, recovery), initializes every
+// plugin in plugins against ts.db, and serves on an ephemeral listener. It
+// does not include the grpcerrors translation interceptors, and recovery
+// uses its default handler rather than production's panicHandler.
+func (ts *TestServer) startGRPC(t *testing.T, plugins []registry.Plugin) {
+	t.Helper()
+
+	logger := log.NewEntry(log.New())
+	tracer, closer := jaeger.NewTracer("todo-testserver", jaeger.NewConstSampler(false), jaeger.NewNullReporter())
+	t.Cleanup(func() { closer.Close() })
+
+	server := grpc.NewServer(
+		grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(
+			grpc_ctxtags.StreamServerInterceptor(grpc_ctxtags.WithFieldExtractor(grpc_ctxtags.CodeGenRequestFieldExtractor)),
+			grpc_opentracing.StreamServerInterceptor(grpc_opentracing.WithTracer(tracer)),
+			grpc_prometheus.StreamServerInterceptor,
+			grpc_logrus.StreamServerInterceptor(logger),
+			grpc_recovery.StreamServerInterceptor(),
+		)),
+		grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(
+			grpc_ctxtags.UnaryServerInterceptor(grpc_ctxtags.WithFieldExtractor(grpc_ctxtags.CodeGenRequestFieldExtractor)),
+			grpc_opentracing.UnaryServerInterceptor(grpc_opentracing.WithTracer(tracer)),
+			grpc_prometheus.UnaryServerInterceptor,
+			grpc_logrus.UnaryServerInterceptor(logger),
+			grpc_recovery.UnaryServerInterceptor(),
+		)),
+	)
+
+	deps := &registry.Deps{Mongo: ts.db}
+	for _, p := range plugins {
+		p := p
+		svc, err := p.Init(context.Background(), deps)
+		if err != nil {
+			t.Fatalf("testserver: init plugin %s: %s", p.ID(), err)
+		}
+		t.Cleanup(func() {
+			if err := svc.Close(); err != nil {
+				log.WithError(err).Warnf("testserver: close plugin %s service", p.ID())
+			}
+		})
+		p.RegisterGRPC(server)
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("testserver: listen grpc: %s", err)
+	}
+	ts.grpcServer = server
+	ts.grpcListener = lis
+
+	go func() {
+		if err := server.Serve(lis); err != nil && err != grpc.ErrServerStopped {
+			log.WithError(err).Warn("testserver: grpc serve")
+		}
+	}()
+	t.Cleanup(server.GracefulStop)
+}
+
+// startGateway registers plugins' grpc-gateway handlers against ts's gRPC
+// listener and serves them on an httptest.Server, so HTTPURL is ready the
+// moment New returns.
+func (ts *TestServer) startGateway(t *testing.T, plugins []registry.Plugin) {
+	t.Helper()
+
+	conn, err := grpc.Dial(ts.grpcListener.Addr().String(), grpc.WithInsecure(), grpc.WithBlock(), grpc.WithTimeout(5*time.Second))
+	if err != nil {
+		t.Fatalf("testserver: dial grpc for gateway: %s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	mux := grpc_runtime.NewServeMux()
+	for _, p := range plugins {
+		if err := p.RegisterGateway(context.Background(), mux, conn); err != nil {
+			t.Fatalf("testserver: register gateway for plugin %s: %s", p.ID(), err)
+		}
+	}
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	ts.httpServer = srv
+	ts.HTTPURL = srv.URL
+}
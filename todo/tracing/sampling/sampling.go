@@ -0,0 +1,155 @@
+// Package sampling implements a remote Jaeger sampling strategy server:
+// it loads per-operation strategies from a JSON file, serves them over
+// GET /sampling?service=<name> in the Jaeger wire format, and reloads the
+// file on change via fsnotify so operators don't have to restart every
+// client of the todo service to change sampling.
+package sampling
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ProbabilisticSampling is the Jaeger wire format for a probabilistic
+// sampler.
+type ProbabilisticSampling struct {
+	SamplingRate float64 `json:"samplingRate"`
+}
+
+// OperationStrategy overrides the service-level strategy for one operation.
+type OperationStrategy struct {
+	Operation             string                 `json:"operation"`
+	ProbabilisticSampling *ProbabilisticSampling `json:"probabilisticSampling,omitempty"`
+}
+
+// Strategy is the Jaeger wire format returned by GET /sampling?service=.
+type Strategy struct {
+	StrategyType          int                    `json:"strategyType"`
+	ProbabilisticSampling *ProbabilisticSampling `json:"probabilisticSampling,omitempty"`
+	OperationStrategies   []OperationStrategy    `json:"operationStrategies,omitempty"`
+}
+
+// DefaultStrategy is returned for any service with no entry in the loaded
+// file, matching the probability the const sampler used to hardcode.
+var DefaultStrategy = Strategy{
+	StrategyType:          0,
+	ProbabilisticSampling: &ProbabilisticSampling{SamplingRate: 0.001},
+}
+
+// Store holds the current per-service strategies and the counter of
+// GET /sampling requests. The zero value is not usable; use NewStore.
+type Store struct {
+	mu         sync.RWMutex
+	strategies map[string]Strategy
+
+	requests *prometheus.CounterVec
+}
+
+// NewStore returns an empty Store; call LoadFile to populate it.
+func NewStore() *Store {
+	return &Store{
+		strategies: make(map[string]Strategy),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "sampling_strategy_requests_total",
+			Help: "Count of GET /sampling requests, by service.",
+		}, []string{"service"}),
+	}
+}
+
+// LoadFile parses path, a JSON object mapping service name to Strategy,
+// and replaces the store's contents atomically.
+func (s *Store) LoadFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	strategies := make(map[string]Strategy)
+	if err := json.Unmarshal(data, &strategies); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.strategies = strategies
+	s.mu.Unlock()
+	return nil
+}
+
+// WatchFile reloads path whenever it changes on disk. A reload that fails
+// to parse is logged and the previous strategies are kept, so a bad edit
+// can't take sampling down. It returns a stop func that releases the
+// watcher.
+func (s *Store) WatchFile(path string) (func(), error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != filepath.Clean(path) {
+					continue
+				}
+				if event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+					continue
+				}
+				if err := s.LoadFile(path); err != nil {
+					log.Printf("sampling: reload %s: %s", path, err)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("sampling: watch %s: %s", path, err)
+			case <-done:
+				watcher.Close()
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }, nil
+}
+
+// Handler serves GET /sampling?service=<name>, returning DefaultStrategy
+// for any service without an entry.
+func (s *Store) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		service := r.URL.Query().Get("service")
+		s.requests.WithLabelValues(service).Inc()
+
+		s.mu.RLock()
+		strategy, ok := s.strategies[service]
+		s.mu.RUnlock()
+		if !ok {
+			strategy = DefaultStrategy
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(strategy); err != nil {
+			log.Printf("sampling: encode response for %q: %s", service, err)
+		}
+	}
+}
+
+// Describe implements prometheus.Collector so Store can be registered
+// directly alongside the process's other metrics.
+func (s *Store) Describe(ch chan<- *prometheus.Desc) { s.requests.Describe(ch) }
+
+// Collect implements prometheus.Collector.
+func (s *Store) Collect(ch chan<- prometheus.Metric) { s.requests.Collect(ch) }